@@ -0,0 +1,139 @@
+package sched
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// defaultAdaptiveK is the default number of standard deviations above the
+// rolling baseline a sample must exceed to be flagged bad, when adaptive
+// mode is enabled with SetAdaptiveMode.
+const defaultAdaptiveK = 4.0
+
+// SetAdaptiveMode enables or disables adaptive thresholds on the default
+// Collector. When enabled, a sample is considered bad if it exceeds its
+// metric's rolling EWMA baseline by more than k standard deviations (see
+// SetAdaptiveK), instead of being compared against the static
+// Oversleep/ChanSend/PingPong/ChainThreshold variables. This avoids the
+// need to hand-tune thresholds per environment (GAE vs bare metal vs
+// containers). Preemption and GCPause have no baseline and are always
+// checked against Thresholds; see Collector.exceeded.
+func SetAdaptiveMode(on bool) {
+	defaultCollector().SetAdaptiveMode(on)
+}
+
+// SetAdaptiveK sets the number of standard deviations above baseline a
+// sample must exceed to be flagged bad on the default Collector, when
+// adaptive mode is enabled. The default is 4.
+func SetAdaptiveK(k float64) {
+	defaultCollector().SetAdaptiveK(k)
+}
+
+// SetAdaptiveMode enables or disables adaptive thresholds for c. See the
+// package-level SetAdaptiveMode.
+func (c *Collector) SetAdaptiveMode(on bool) {
+	c.adaptive.mu.Lock()
+	defer c.adaptive.mu.Unlock()
+	c.adaptive.enabled = on
+}
+
+// SetAdaptiveK sets the number of standard deviations above baseline a
+// sample must exceed to be flagged bad for c, when adaptive mode is
+// enabled. The default is 4.
+func (c *Collector) SetAdaptiveK(k float64) {
+	c.adaptive.mu.Lock()
+	defer c.adaptive.mu.Unlock()
+	c.adaptive.k = k
+}
+
+// baselineAlpha is the EWMA smoothing factor used by baselineTracker; a
+// small value means the baseline adapts slowly and rides out brief spikes.
+const baselineAlpha = 0.05
+
+// baselineTracker maintains a rolling EWMA mean and standard deviation for
+// one measurement in O(1) space, used by adaptive mode to flag outliers
+// without static, hand-tuned thresholds.
+type baselineTracker struct {
+	mu       sync.Mutex
+	mean     float64
+	variance float64
+	init     bool
+}
+
+func (b *baselineTracker) observe(x float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.init {
+		b.mean, b.variance, b.init = x, 0, true
+		return
+	}
+	delta := x - b.mean
+	b.mean += baselineAlpha * delta
+	b.variance = (1 - baselineAlpha) * (b.variance + baselineAlpha*delta*delta)
+}
+
+func (b *baselineTracker) stats() (mean, stddev float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.mean, math.Sqrt(b.variance)
+}
+
+func (b *baselineTracker) exceeds(x, k float64) bool {
+	mean, stddev := b.stats()
+	return x > mean+k*stddev
+}
+
+// adaptiveState holds one Collector's adaptive-mode configuration and
+// rolling baselines, so that independent Collectors never share or
+// cross-pollute each other's thresholds.
+type adaptiveState struct {
+	mu      sync.Mutex
+	enabled bool
+	k       float64
+
+	oversleep baselineTracker
+	bufSend   baselineTracker
+	pingPong  baselineTracker
+	chain     baselineTracker
+}
+
+func (a *adaptiveState) config() (enabled bool, k float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.enabled, a.k
+}
+
+// observe feeds a collected Sample into the rolling baselines, so they
+// keep warming up whether or not adaptive mode is currently enabled.
+func (a *adaptiveState) observe(s Sample) {
+	a.oversleep.observe(float64(s.Oversleep))
+	a.bufSend.observe(float64(s.BufSend))
+	a.pingPong.observe(float64(s.PingPong))
+	a.chain.observe(float64(s.Chain))
+}
+
+// exceeded reports whether s exceeds any of the four baselines that have
+// one (Oversleep, BufSend, PingPong, Chain) by more than k standard
+// deviations. It does not consider Preemption or GCPause, which have no
+// baseline; see Collector.exceeded.
+func (a *adaptiveState) exceeded(s Sample, k float64) bool {
+	return a.oversleep.exceeds(float64(s.Oversleep), k) ||
+		a.bufSend.exceeds(float64(s.BufSend), k) ||
+		a.pingPong.exceeds(float64(s.PingPong), k) ||
+		a.chain.exceeds(float64(s.Chain), k)
+}
+
+// row renders the current EWMA baselines in the same column layout as
+// highlightSample's table, appended as a trailing row when adaptive mode
+// is enabled. Preemption and GCPause have no baseline, so their columns
+// show "-".
+func (a *adaptiveState) row() string {
+	om, _ := a.oversleep.stats()
+	bm, _ := a.bufSend.stats()
+	pm, _ := a.pingPong.stats()
+	cm, _ := a.chain.stats()
+	return fmt.Sprintf("| %12s | %10v | %10v | %10v | %10v | %10s | %10s |\n",
+		"baseline", time.Duration(om), time.Duration(bm), time.Duration(pm), time.Duration(cm), "-", "-")
+}
@@ -0,0 +1,26 @@
+package sched
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBaselineTrackerExceeds(t *testing.T) {
+	b := &baselineTracker{}
+	for i := 0; i < 200; i++ {
+		b.observe(10)
+	}
+	mean, stddev := b.stats()
+	if math.Abs(mean-10) > 0.5 {
+		t.Fatalf("mean = %v, want ~10", mean)
+	}
+	if stddev > 0.5 {
+		t.Fatalf("stddev = %v, want ~0 for a constant stream", stddev)
+	}
+	if b.exceeds(10, 4) {
+		t.Fatal("exceeds(10, 4) = true for a sample at the baseline, want false")
+	}
+	if !b.exceeds(1000, 4) {
+		t.Fatal("exceeds(1000, 4) = false for a huge spike, want true")
+	}
+}
@@ -0,0 +1,341 @@
+package sched
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// ErrCollectorNotRunning is returned by Collector.Check when c was never
+// started, or has since been stopped.
+var ErrCollectorNotRunning = errors.New("sched: collector is not running")
+
+// Thresholds holds the latency thresholds a Collector (or the package-level
+// API) considers bad enough to report.
+type Thresholds struct {
+	Oversleep  time.Duration
+	ChanSend   time.Duration
+	PingPong   time.Duration
+	Chain      time.Duration
+	Preemption time.Duration
+	GCPause    time.Duration
+}
+
+func (t Thresholds) exceeded(s Sample) bool {
+	return s.Oversleep > t.Oversleep ||
+		s.BufSend > t.ChanSend ||
+		s.PingPong > t.PingPong ||
+		s.Chain > t.Chain ||
+		s.Preemption > t.Preemption ||
+		s.GCPause > t.GCPause
+}
+
+func currentThresholds() Thresholds {
+	return Thresholds{
+		Oversleep:  OversleepThreshold,
+		ChanSend:   ChanSendThreshold,
+		PingPong:   PingPongThreshold,
+		Chain:      ChainThreshold,
+		Preemption: PreemptionThreshold,
+		GCPause:    GCPauseThreshold,
+	}
+}
+
+// DefaultThresholds returns the thresholds currently configured via the
+// package-level *Threshold variables, suitable as a starting point for a
+// Collector's Thresholds field.
+func DefaultThresholds() Thresholds {
+	return currentThresholds()
+}
+
+// Collector runs the scheduler-latency benchmarks on its own schedule and
+// records the resulting samples to a set of Sinks. Unlike the package-level
+// functions, creating a Collector has no side effects: nothing runs until
+// Start is called, so a library can embed sched without forcing background
+// goroutines on every consumer, and tests can create many independent
+// Collectors with their own thresholds, intervals and sinks. Stop tears
+// down the sampling goroutine cleanly.
+type Collector struct {
+	// Thresholds configures which samples are considered bad. Each sample
+	// is checked against the current value. The sampling goroutine reads
+	// it without synchronization, so it is set before Start is called.
+	Thresholds Thresholds
+
+	interval time.Duration
+	onSample func(Sample) // optional extra hook; used by the default Collector
+
+	mu        sync.Mutex
+	sinks     []Sink
+	nextIndex int
+	samples   [historySize]Sample
+
+	// bufc/unbufc back the PingPong benchmark. channelHelper stays parked
+	// on bufc for the lifetime of the collector, so PingPong measures the
+	// wake-latency of an already-parked goroutine rather than a freshly
+	// spawned one.
+	bufc   chan bool
+	unbufc chan bool
+
+	adaptive adaptiveState
+
+	checkChan chan checkRequest
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// NewCollector creates a Collector that samples every interval and records
+// each sample to sinks. The collector does not start sampling until Start
+// is called.
+func NewCollector(interval time.Duration, sinks ...Sink) *Collector {
+	c := &Collector{
+		Thresholds: DefaultThresholds(),
+		interval:   interval,
+		sinks:      sinks,
+	}
+	c.adaptive.k = defaultAdaptiveK
+	return c
+}
+
+// Start creates a Collector using the package-level thresholds and sample
+// interval, starts it sampling in the background, and returns it. Sampling
+// runs until ctx is cancelled or the returned Collector's Stop method is
+// called.
+func Start(ctx context.Context, sinks ...Sink) *Collector {
+	return NewCollector(sampleInterval-testSleep, sinks...).Start(ctx)
+}
+
+// Start begins sampling in a background goroutine and returns c, so
+// construction and starting can be chained. Sampling runs until ctx is
+// cancelled or Stop is called.
+func (c *Collector) Start(ctx context.Context) *Collector {
+	ctx, cancel := context.WithCancel(ctx)
+	c.checkChan = make(chan checkRequest)
+	c.bufc = make(chan bool, 1)
+	c.unbufc = make(chan bool)
+	c.cancel = cancel
+	c.done = make(chan struct{})
+	// The PingPong helper is stopped only once run has returned, so a
+	// sample that is in progress when ctx is cancelled can still finish.
+	helperCtx, stopHelper := context.WithCancel(context.Background())
+	go c.channelHelper(helperCtx)
+	go func() {
+		defer stopHelper()
+		c.run(ctx)
+	}()
+	return c
+}
+
+// channelHelper relays values from bufc to unbufc for as long as ctx is
+// live, giving the PingPong benchmark a goroutine that's always already
+// parked and waiting, rather than one spawned fresh for each sample.
+func (c *Collector) channelHelper(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case v := <-c.bufc:
+			select {
+			case c.unbufc <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// Stop cancels c's background sampling goroutine and waits for it to exit.
+// It's safe to call Stop more than once, and safe to call it on a
+// Collector that was never started.
+func (c *Collector) Stop() {
+	if c.cancel == nil {
+		return
+	}
+	c.cancel()
+	<-c.done
+}
+
+// checkRequest is sent on a Collector's checkChan to ask its run loop to
+// report any recent bad sample to warner, and is closed once handled.
+type checkRequest struct {
+	warner Warner
+	done   chan struct{}
+}
+
+func (c *Collector) run(ctx context.Context) {
+	defer close(c.done)
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	var bad *Sample
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s := c.collectOnce()
+			if c.exceeded(s) {
+				bad = &s
+			}
+		case req := <-c.checkChan:
+			if bad != nil {
+				req.warner.Warningf("Recent sample exceeded threshold.\nLast %v samples:\n%s", historySize, c.highlightSample(*bad))
+				bad = nil
+			}
+			close(req.done)
+		}
+	}
+}
+
+// Check tests whether c recently collected a sample that exceeded its
+// Thresholds and, if so, uses w to log a warning containing a table of the
+// most recent samples. It respects ctx's cancellation and deadline rather
+// than blocking forever if c's sampling goroutine is wedged, and returns
+// ErrCollectorNotRunning immediately if c was never started or has since
+// been stopped.
+func (c *Collector) Check(ctx context.Context, w Warner) error {
+	if c.checkChan == nil {
+		return ErrCollectorNotRunning
+	}
+	req := checkRequest{warner: w, done: make(chan struct{})}
+	select {
+	case c.checkChan <- req:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.done:
+		return ErrCollectorNotRunning
+	}
+	select {
+	case <-req.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.done:
+		return ErrCollectorNotRunning
+	}
+}
+
+// exceeded reports whether s should be considered bad. When adaptive mode
+// is enabled (see SetAdaptiveMode), Oversleep/BufSend/PingPong/Chain are
+// checked against c's rolling baselines; Preemption and GCPause have no
+// baseline yet, so they're always checked against c.Thresholds.
+func (c *Collector) exceeded(s Sample) bool {
+	if enabled, k := c.adaptive.config(); enabled {
+		return c.adaptive.exceeded(s, k) ||
+			s.Preemption > c.Thresholds.Preemption ||
+			s.GCPause > c.Thresholds.GCPause
+	}
+	return c.Thresholds.exceeded(s)
+}
+
+// AddSink registers an additional Sink with the collector.
+func (c *Collector) AddSink(s Sink) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sinks = append(c.sinks, s)
+}
+
+// measureSample runs the benchmarks once, using c's long-lived PingPong
+// helper goroutine, and returns the resulting Sample.
+func (c *Collector) measureSample() Sample {
+	var s Sample
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	s.Start = time.Now()
+	time.Sleep(testSleep)
+	t1 := time.Now()
+	s.Oversleep = t1.Sub(s.Start) - testSleep
+
+	s.Preemption = probePreemption()
+	t1 = time.Now()
+
+	c.bufc <- true
+	t2 := time.Now()
+	s.BufSend = t2.Sub(t1)
+	<-c.unbufc
+	t3 := time.Now()
+	s.PingPong = t3.Sub(t2)
+
+	head := make(chan bool)
+	tail := head
+	for i := 0; i < numChainRoutines; i++ {
+		ch := make(chan bool)
+		go func(a, b chan bool) {
+			b <- <-a
+		}(tail, ch)
+		tail = ch
+	}
+	head <- true
+	<-tail
+	s.Chain = time.Now().Sub(t3)
+
+	runtime.ReadMemStats(&after)
+	s.GCPause = time.Duration(after.PauseTotalNs - before.PauseTotalNs)
+
+	return s
+}
+
+// collectOnce runs the benchmarks once, records the sample to c's history
+// and sinks, and returns it.
+func (c *Collector) collectOnce() Sample {
+	s := c.measureSample()
+	c.adaptive.observe(s)
+	if c.onSample != nil {
+		c.onSample(s)
+	}
+
+	c.mu.Lock()
+	idx := c.nextIndex
+	c.nextIndex = (c.nextIndex + 1) % historySize
+	c.samples[idx] = s
+	sinks := append([]Sink(nil), c.sinks...)
+	c.mu.Unlock()
+
+	for _, sk := range sinks {
+		sk.Record(s)
+	}
+
+	return s
+}
+
+// Samples returns a text table of the collector's last 100 samples, in the
+// same format as the package-level Samples function.
+func (c *Collector) Samples() string {
+	return c.highlightSample(Sample{})
+}
+
+func (c *Collector) highlightSample(hl Sample) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var buf bytes.Buffer
+
+	fmt.Fprintln(&buf, header)
+	idx := c.nextIndex
+	now := time.Now()
+	for n := 0; n < historySize; n++ {
+		idx--
+		if idx < 0 {
+			idx = historySize - 1
+		}
+		s := &c.samples[idx]
+		if s.Start.IsZero() {
+			break
+		}
+		hls := ""
+		if *s == hl {
+			hls = " <---"
+		}
+		fmt.Fprintf(&buf, "| %7.1fs ago | %10v | %10v | %10v | %10v | %10v | %10v |%s\n",
+			now.Sub(s.Start).Seconds(),
+			s.Oversleep, s.BufSend, s.PingPong, s.Chain, s.Preemption, s.GCPause,
+			hls)
+	}
+	if enabled, _ := c.adaptive.config(); enabled {
+		buf.WriteString(c.adaptive.row())
+	}
+	return buf.String()
+}
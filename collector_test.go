@@ -0,0 +1,60 @@
+package sched
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeWarner records Warningf calls for assertions.
+type fakeWarner struct {
+	calls int
+}
+
+func (w *fakeWarner) Warningf(string, ...interface{}) {
+	w.calls++
+}
+
+func TestCollectorCheckNeverStarted(t *testing.T) {
+	c := NewCollector(time.Second)
+	if err := c.Check(context.Background(), &fakeWarner{}); err != ErrCollectorNotRunning {
+		t.Fatalf("Check on an unstarted Collector = %v, want ErrCollectorNotRunning", err)
+	}
+}
+
+func TestCollectorCheckAfterStop(t *testing.T) {
+	c := NewCollector(time.Hour) // long enough that the ticker never fires
+	c.Start(context.Background())
+	c.Stop()
+
+	done := make(chan error, 1)
+	go func() { done <- c.Check(context.Background(), &fakeWarner{}) }()
+
+	select {
+	case err := <-done:
+		if err != ErrCollectorNotRunning {
+			t.Fatalf("Check after Stop = %v, want ErrCollectorNotRunning", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Check after Stop deadlocked")
+	}
+}
+
+func TestCollectorCheckReportsExceededSample(t *testing.T) {
+	c := NewCollector(20 * time.Millisecond)
+	c.Thresholds.Oversleep = -1 // always exceeded
+	c.Start(context.Background())
+	defer c.Stop()
+
+	w := &fakeWarner{}
+	deadline := time.Now().Add(2 * time.Second)
+	for w.calls == 0 && time.Now().Before(deadline) {
+		if err := c.Check(context.Background(), w); err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if w.calls == 0 {
+		t.Fatal("Check never reported the exceeded sample")
+	}
+}
@@ -0,0 +1,96 @@
+package sched
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HistogramBuckets configures the upper bounds of the OpenMetrics
+// histograms served by Handler, expressed as multiples of the
+// corresponding *Threshold variable. The bucket boundaries are fixed the
+// first time a sample for that measurement is recorded.
+var HistogramBuckets = []float64{0.25, 0.5, 1, 2, 4, 8}
+
+// histogram is a cumulative histogram with a fixed set of bucket upper
+// bounds, suitable for OpenMetrics/Prometheus exposition.
+type histogram struct {
+	once   sync.Once
+	mu     sync.Mutex
+	bounds []time.Duration // ascending; +Inf is implied
+	counts []uint64        // counts[i] = observations <= bounds[i]
+	sum    time.Duration
+	count  uint64
+}
+
+func (h *histogram) init(threshold time.Duration) {
+	h.once.Do(func() {
+		h.bounds = make([]time.Duration, len(HistogramBuckets))
+		for i, m := range HistogramBuckets {
+			h.bounds[i] = time.Duration(float64(threshold) * m)
+		}
+		h.counts = make([]uint64, len(h.bounds))
+	})
+}
+
+func (h *histogram) observe(threshold, d time.Duration) {
+	h.init(threshold)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sum += d
+	h.count++
+	for i, b := range h.bounds {
+		if d <= b {
+			h.counts[i]++
+		}
+	}
+}
+
+func (h *histogram) writeTo(w io.Writer, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, b := range h.bounds {
+		fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", name, b.Seconds(), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %g\n", name, h.sum.Seconds())
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
+
+var (
+	oversleepHist  = &histogram{}
+	bufSendHist    = &histogram{}
+	pingPongHist   = &histogram{}
+	chainHist      = &histogram{}
+	preemptionHist = &histogram{}
+	gcPauseHist    = &histogram{}
+)
+
+// Handler returns an http.Handler that serves the current metrics in
+// OpenMetrics/Prometheus exposition format, so scheduler-latency signals
+// can be scraped from long-running Go services instead of polling Check
+// from a request handler.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defaultCollector()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetric(w, "sched_oversleep", oversleepQuantiles, oversleepHist)
+		writeMetric(w, "sched_chan_send", bufSendQuantiles, bufSendHist)
+		writeMetric(w, "sched_ping_pong", pingPongQuantiles, pingPongHist)
+		writeMetric(w, "sched_chain", chainQuantiles, chainHist)
+		writeMetric(w, "sched_preemption", preemptionQuantiles, preemptionHist)
+		writeMetric(w, "sched_gc_pause", gcPauseQuantiles, gcPauseHist)
+	})
+}
+
+func writeMetric(w io.Writer, name string, t *metricTracker, h *histogram) {
+	q := t.quantiles()
+	fmt.Fprintf(w, "# TYPE %s_seconds summary\n", name)
+	fmt.Fprintf(w, "%s_seconds{quantile=\"0.5\"} %g\n", name, q.P50.Seconds())
+	fmt.Fprintf(w, "%s_seconds{quantile=\"0.9\"} %g\n", name, q.P90.Seconds())
+	fmt.Fprintf(w, "%s_seconds{quantile=\"0.99\"} %g\n", name, q.P99.Seconds())
+	fmt.Fprintf(w, "# TYPE %s_seconds_hist histogram\n", name)
+	h.writeTo(w, name+"_seconds_hist")
+}
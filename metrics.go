@@ -0,0 +1,198 @@
+package sched
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// quantileLevels are the percentiles tracked for each measurement.
+var quantileLevels = [3]float64{0.50, 0.90, 0.99}
+
+// quantileEstimator estimates a single quantile of a stream of values in
+// O(1) space using the P² algorithm (Jain & Chlamtac, 1985). It never
+// stores more than five markers, so its memory use does not grow with
+// uptime.
+type quantileEstimator struct {
+	p       float64
+	heights [5]float64
+	n       [5]int64
+	npos    [5]float64
+	dn      [5]float64
+	init    []float64 // buffered until the first 5 observations arrive
+}
+
+func newQuantileEstimator(p float64) *quantileEstimator {
+	return &quantileEstimator{p: p}
+}
+
+func (q *quantileEstimator) observe(x float64) {
+	if len(q.init) < 5 {
+		q.init = append(q.init, x)
+		if len(q.init) == 5 {
+			sort.Float64s(q.init)
+			copy(q.heights[:], q.init)
+			for i := range q.n {
+				q.n[i] = int64(i + 1)
+			}
+			q.npos = [5]float64{1, 1 + 2*q.p, 1 + 4*q.p, 3 + 2*q.p, 5}
+			q.dn = [5]float64{0, q.p / 2, q.p, (1 + q.p) / 2, 1}
+		}
+		return
+	}
+
+	var k int
+	switch {
+	case x < q.heights[0]:
+		q.heights[0] = x
+		k = 0
+	case x >= q.heights[4]:
+		q.heights[4] = x
+		k = 3
+	default:
+		for i := 0; i < 4; i++ {
+			if x < q.heights[i+1] {
+				k = i
+				break
+			}
+		}
+	}
+
+	for i := k + 1; i < 5; i++ {
+		q.n[i]++
+	}
+	for i := range q.npos {
+		q.npos[i] += q.dn[i]
+	}
+
+	for i := 1; i < 4; i++ {
+		d := q.npos[i] - float64(q.n[i])
+		if (d >= 1 && q.n[i+1]-q.n[i] > 1) || (d <= -1 && q.n[i-1]-q.n[i] < -1) {
+			sign := 1.0
+			if d < 0 {
+				sign = -1.0
+			}
+			h := q.parabolic(i, sign)
+			if q.heights[i-1] < h && h < q.heights[i+1] {
+				q.heights[i] = h
+			} else {
+				q.heights[i] = q.linear(i, sign)
+			}
+			q.n[i] += int64(sign)
+		}
+	}
+}
+
+func (q *quantileEstimator) parabolic(i int, d float64) float64 {
+	return q.heights[i] + d/float64(q.n[i+1]-q.n[i-1])*
+		((float64(q.n[i])-float64(q.n[i-1])+d)*(q.heights[i+1]-q.heights[i])/float64(q.n[i+1]-q.n[i])+
+			(float64(q.n[i+1])-float64(q.n[i])-d)*(q.heights[i]-q.heights[i-1])/float64(q.n[i]-q.n[i-1]))
+}
+
+func (q *quantileEstimator) linear(i int, d float64) float64 {
+	j := i + int(d)
+	return q.heights[i] + d*(q.heights[j]-q.heights[i])/float64(int64(q.n[j])-q.n[i])
+}
+
+// value returns the current quantile estimate. Until 5 samples have been
+// observed it returns the quantile of the samples seen so far, or zero if
+// there are none.
+func (q *quantileEstimator) value() time.Duration {
+	if len(q.init) < 5 {
+		if len(q.init) == 0 {
+			return 0
+		}
+		sorted := append([]float64(nil), q.init...)
+		sort.Float64s(sorted)
+		idx := int(q.p * float64(len(sorted)-1))
+		return time.Duration(sorted[idx])
+	}
+	return time.Duration(q.heights[2])
+}
+
+// metricTracker keeps rolling p50/p90/p99 estimates for one measurement.
+type metricTracker struct {
+	mu  sync.Mutex
+	est [3]*quantileEstimator
+}
+
+func newMetricTracker() *metricTracker {
+	return &metricTracker{est: [3]*quantileEstimator{
+		newQuantileEstimator(quantileLevels[0]),
+		newQuantileEstimator(quantileLevels[1]),
+		newQuantileEstimator(quantileLevels[2]),
+	}}
+}
+
+func (t *metricTracker) observe(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, e := range t.est {
+		e.observe(float64(d))
+	}
+}
+
+func (t *metricTracker) quantiles() Quantile {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return Quantile{t.est[0].value(), t.est[1].value(), t.est[2].value()}
+}
+
+var (
+	oversleepQuantiles  = newMetricTracker()
+	bufSendQuantiles    = newMetricTracker()
+	pingPongQuantiles   = newMetricTracker()
+	chainQuantiles      = newMetricTracker()
+	preemptionQuantiles = newMetricTracker()
+	gcPauseQuantiles    = newMetricTracker()
+)
+
+// Quantile holds the p50, p90 and p99 estimates for a single measurement.
+type Quantile struct {
+	P50, P90, P99 time.Duration
+}
+
+// MetricsSnapshot is a point-in-time view of the rolling quantiles for each
+// of the measurements that Check observes.
+type MetricsSnapshot struct {
+	Oversleep  Quantile
+	BufSend    Quantile
+	PingPong   Quantile
+	Chain      Quantile
+	Preemption Quantile
+	GCPause    Quantile
+}
+
+// Metrics returns a snapshot of the current rolling quantiles for each
+// measurement, as observed by the default Collector (started on first use;
+// see Check). It's cheaper than Samples and is suitable for exporting to a
+// structured logging or monitoring system; see also Handler, which serves
+// the same data in OpenMetrics/Prometheus exposition format.
+func Metrics() MetricsSnapshot {
+	defaultCollector()
+	return MetricsSnapshot{
+		Oversleep:  oversleepQuantiles.quantiles(),
+		BufSend:    bufSendQuantiles.quantiles(),
+		PingPong:   pingPongQuantiles.quantiles(),
+		Chain:      chainQuantiles.quantiles(),
+		Preemption: preemptionQuantiles.quantiles(),
+		GCPause:    gcPauseQuantiles.quantiles(),
+	}
+}
+
+// recordGlobalMetrics feeds a Sample from the default Collector into the
+// quantile and histogram trackers backing Metrics and Handler.
+func recordGlobalMetrics(s Sample) {
+	oversleepQuantiles.observe(s.Oversleep)
+	oversleepHist.observe(OversleepThreshold, s.Oversleep)
+	bufSendQuantiles.observe(s.BufSend)
+	bufSendHist.observe(ChanSendThreshold, s.BufSend)
+	pingPongQuantiles.observe(s.PingPong)
+	pingPongHist.observe(PingPongThreshold, s.PingPong)
+	chainQuantiles.observe(s.Chain)
+	chainHist.observe(ChainThreshold, s.Chain)
+	preemptionQuantiles.observe(s.Preemption)
+	preemptionHist.observe(PreemptionThreshold, s.Preemption)
+	gcPauseQuantiles.observe(s.GCPause)
+	gcPauseHist.observe(GCPauseThreshold, s.GCPause)
+}
@@ -0,0 +1,41 @@
+package sched
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuantileEstimator(t *testing.T) {
+	tests := []struct {
+		p        float64
+		wantLow  float64
+		wantHigh float64
+	}{
+		{0.50, 400, 600},
+		{0.90, 820, 950},
+		{0.99, 950, 1000},
+	}
+	for _, tt := range tests {
+		q := newQuantileEstimator(tt.p)
+		for i := 1; i <= 1000; i++ {
+			q.observe(float64(i))
+		}
+		got := float64(q.value())
+		if got < tt.wantLow || got > tt.wantHigh {
+			t.Errorf("p=%v: value() = %v, want between %v and %v", tt.p, got, tt.wantLow, tt.wantHigh)
+		}
+	}
+}
+
+func TestQuantileEstimatorFewSamples(t *testing.T) {
+	q := newQuantileEstimator(0.50)
+	if got := q.value(); got != 0 {
+		t.Fatalf("value() with no samples = %v, want 0", got)
+	}
+	for _, x := range []float64{3, 1, 2} {
+		q.observe(x)
+	}
+	if got, want := q.value(), time.Duration(2); got != want {
+		t.Fatalf("value() with 3 samples = %v, want %v", got, want)
+	}
+}
@@ -1,27 +1,50 @@
 // Package shed provides a basic mechanism to test the latency of the Go
-// runtime scheduler. When imported, it periodically performs a series of
-// short benchmarks and records the timings. These include:
+// runtime scheduler. It periodically performs a series of short benchmarks
+// and records the timings. These include:
 // 	- An unbuffered channel send. ("ChanSend")
 // 	- Sending a value from one goroutine to another and back. ("PingPong")
 // 	- How much longer a goroutine takes to wake after its sleep period.
 // 	  ("Oversleep")
 // 	- How long it takes to create 20 goroutines and pass a message through
 // 	  all of them. ("Chain")
+// 	- The longest gap between consecutive clock reads in a tight loop, to
+// 	  detect non-cooperative preemption stalls. ("Preemption")
+// 	- GC stop-the-world pause time observed during the sample, from
+// 	  runtime.MemStats.PauseTotalNs. ("GCPause")
+//
+// The package-level Check and Samples functions are backed by a default
+// Collector, lazily started on first use, so importing the package has no
+// side effects of its own. Library code that wants its own lifecycle
+// (independent thresholds, sample interval, sinks, and a clean shutdown)
+// should use Start or NewCollector directly instead.
+//
+// Rolling p50/p90/p99 quantiles for each measurement are available via
+// Metrics, and Handler serves them in OpenMetrics/Prometheus exposition
+// format for scraping.
+//
+// SetAdaptiveMode switches from the static *Threshold variables to an
+// adaptive model that flags a sample bad when it exceeds a rolling EWMA
+// baseline by more than a configurable number of standard deviations (see
+// SetAdaptiveK), which avoids hand-tuning thresholds per environment.
 package sched
 
 import (
-	"bytes"
-	"fmt"
+	"context"
 	"sync"
 	"time"
 )
 
-// These values may be changed to configure the thresholds observed by Check.
+// These values may be changed to configure the thresholds observed by
+// Check, and seed the Thresholds of any Collector subsequently created with
+// NewCollector or Start. The default Collector behind Check copies them
+// once, when it is first used; later changes do not affect Check.
 var (
-	OversleepThreshold = 3 * time.Millisecond
-	ChanSendThreshold  = 10 * time.Microsecond
-	PingPongThreshold  = 20 * time.Microsecond
-	ChainThreshold     = 400 * time.Microsecond
+	OversleepThreshold  = 3 * time.Millisecond
+	ChanSendThreshold   = 10 * time.Microsecond
+	PingPongThreshold   = 20 * time.Microsecond
+	ChainThreshold      = 400 * time.Microsecond
+	PreemptionThreshold = 200 * time.Microsecond
+	GCPauseThreshold    = 500 * time.Microsecond
 )
 
 // Warner is anything that can log warnings.
@@ -32,7 +55,10 @@ type Warner interface {
 
 // Check tests whether we recently observed samples that exceeded the
 // thresholds and, if so, uses the provided Warner to log a warning message
-// containing a table of the most recent samples.
+// containing a table of the most recent samples. It's a thin wrapper
+// around the default Collector's Check, with a background context; for a
+// context-aware, cancellable equivalent, create a Collector with Start and
+// call its Check method.
 //
 // For example:
 // 	func handler(w http.ResponseWriter, r *http.Request) {
@@ -41,7 +67,20 @@ type Warner interface {
 // 		// the rest of your code as usual
 // 	}
 func Check(w Warner) {
-	checkChan <- w
+	defaultCollector().Check(context.Background(), w)
+}
+
+// Samples returns a text table of the default Collector's last 100
+// samples.
+func Samples() string {
+	return defaultCollector().Samples()
+}
+
+// AddSink registers a Sink that receives every sample collected by the
+// default Collector, in addition to the existing Check/Samples behavior.
+// See Collector for an embeddable alternative with independent sinks.
+func AddSink(s Sink) {
+	defaultCollector().AddSink(s)
 }
 
 const (
@@ -51,99 +90,53 @@ const (
 	numChainRoutines = 20
 )
 
-var (
-	mu        sync.Mutex
-	nextIndex int
-	samples   [historySize]sample
-)
-
-type sample struct {
-	start     time.Time
-	oversleep time.Duration // undesired extra sleep latency
-	bufSend   time.Duration // send on a buffered channel
-	pingPong  time.Duration // ping-pong with goroutine on buffered channel
-	chain     time.Duration
-}
-
-func init() {
-	go channelHelper()
-	go collectSampleLoop()
+// Sample holds the timings collected by a single run of the benchmarks.
+type Sample struct {
+	Start      time.Time     `json:"start"`
+	Oversleep  time.Duration `json:"oversleep"`  // undesired extra sleep latency
+	BufSend    time.Duration `json:"buf_send"`   // send on a buffered channel
+	PingPong   time.Duration `json:"ping_pong"`  // ping-pong with goroutine on buffered channel
+	Chain      time.Duration `json:"chain"`
+	Preemption time.Duration `json:"preemption"` // longest gap seen in a tight, non-cooperative loop
+	GCPause    time.Duration `json:"gc_pause"`   // GC STW pause time observed during the sample
 }
 
 var (
-	unbufc = make(chan bool)
-	bufc   = make(chan bool, 1)
+	defaultOnce sync.Once
+	defaultColl *Collector
 )
 
-func collectSampleLoop() {
-	ticker := time.NewTicker(sampleInterval - testSleep)
-	var bad *sample
-	for {
-		select {
-		case <-ticker.C:
-			s := collectSample()
-			if overThreshold(s) {
-				bad = &s
-			}
-		case w := <-checkChan:
-			if bad != nil {
-				w.Warningf("Recent sample exceeded threshold.\nLast %v samples:\n%s", historySize, highlightSample(*bad))
-				bad = nil
-			}
-		}
-	}
-}
-
-func overThreshold(s sample) bool {
-	return s.oversleep > OversleepThreshold ||
-		s.bufSend > ChanSendThreshold ||
-		s.pingPong > PingPongThreshold ||
-		s.chain > ChainThreshold
+// defaultCollector returns the package-level Collector backing Check,
+// Samples and AddSink, starting it on first use.
+func defaultCollector() *Collector {
+	defaultOnce.Do(func() {
+		c := NewCollector(sampleInterval - testSleep)
+		c.onSample = recordGlobalMetrics
+		c.Start(context.Background())
+		defaultColl = c
+	})
+	return defaultColl
 }
 
-var checkChan = make(chan Warner)
-
-func channelHelper() {
+// probePreemption runs a tight, allocation-free loop for about a
+// millisecond and returns the largest gap observed between successive
+// time.Now readings. A large gap indicates the goroutine was stalled by
+// the runtime scheduler rather than cooperating at a function call.
+func probePreemption() time.Duration {
+	deadline := time.Now().Add(time.Millisecond)
+	last := time.Now()
+	var max time.Duration
 	for {
-		unbufc <- <-bufc
-	}
-}
-
-func collectSample() sample {
-	var s sample
-
-	s.start = time.Now()
-	time.Sleep(testSleep)
-	t1 := time.Now()
-	s.oversleep = t1.Sub(s.start) - testSleep
-
-	bufc <- true
-	t2 := time.Now()
-	s.bufSend = t2.Sub(t1)
-	<-unbufc
-	t3 := time.Now()
-	s.pingPong = t3.Sub(t2)
-
-	head := make(chan bool)
-	tail := head
-	for i := 0; i < numChainRoutines; i++ {
-		ch := make(chan bool)
-		go func(a, b chan bool) {
-			b <- <-a
-		}(tail, ch)
-		tail = ch
+		now := time.Now()
+		if gap := now.Sub(last); gap > max {
+			max = gap
+		}
+		last = now
+		if now.After(deadline) {
+			break
+		}
 	}
-	head <- true
-	<-tail
-	s.chain = time.Now().Sub(t3)
-
-	mu.Lock()
-	defer mu.Unlock()
-	idx := nextIndex
-	nextIndex = (nextIndex + 1) % historySize
-	samples[idx] = s
-
-	return s
+	return max
 }
 
 const header = "| " +
@@ -151,38 +144,6 @@ const header = "| " +
 	"Oversleep  | " +
 	"Chan send  | " +
 	"Ping-pong  | " +
-	"Chain      |"
-
-// Samples returns a text table of the last 100 samples.
-func Samples() string {
-	return highlightSample(sample{})
-}
-
-func highlightSample(hl sample) string {
-	defer mu.Unlock()
-	mu.Lock()
-	var buf bytes.Buffer
-
-	fmt.Fprintln(&buf, header)
-	idx := nextIndex
-	now := time.Now()
-	for n := 0; n < historySize; n++ {
-		idx--
-		if idx < 0 {
-			idx = historySize - 1
-		}
-		s := &samples[idx]
-		if s.start.IsZero() {
-			break
-		}
-		hls := ""
-		if *s == hl {
-			hls = " <---"
-		}
-		fmt.Fprintf(&buf, "| %7.1fs ago | %10v | %10v | %10v | %10v |%s\n",
-			now.Sub(s.start).Seconds(),
-			s.oversleep, s.bufSend, s.pingPong, s.chain,
-			hls)
-	}
-	return buf.String()
-}
+	"Chain      | " +
+	"Preemption | " +
+	"GC pause   |"
@@ -0,0 +1,102 @@
+package sched
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Sink receives samples as they are collected. Implementations must be
+// safe for concurrent use, since Record may be called from the collector's
+// sampling goroutine while Flush is called from another.
+type Sink interface {
+	// Record is called with each Sample as it's collected.
+	Record(Sample)
+	// Flush flushes any buffered state, respecting ctx's deadline.
+	Flush(ctx context.Context) error
+}
+
+// JSONSink writes each Sample as a line of JSON to w.
+type JSONSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONSink returns a Sink that writes newline-delimited JSON to w.
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{w: w}
+}
+
+func (s *JSONSink) Record(sm Sample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	json.NewEncoder(s.w).Encode(sm)
+}
+
+// Flush is a no-op; JSONSink writes each sample immediately.
+func (s *JSONSink) Flush(ctx context.Context) error { return nil }
+
+// CSVSink writes each Sample as a row of CSV to w, preceded by a header row
+// on the first call to Record.
+type CSVSink struct {
+	mu     sync.Mutex
+	w      *csv.Writer
+	header bool
+}
+
+// NewCSVSink returns a Sink that writes CSV rows to w.
+func NewCSVSink(w io.Writer) *CSVSink {
+	return &CSVSink{w: csv.NewWriter(w)}
+}
+
+func (s *CSVSink) Record(sm Sample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.header {
+		s.w.Write([]string{"start", "oversleep", "buf_send", "ping_pong", "chain", "preemption", "gc_pause"})
+		s.header = true
+	}
+	s.w.Write([]string{
+		sm.Start.Format(time.RFC3339Nano),
+		sm.Oversleep.String(),
+		sm.BufSend.String(),
+		sm.PingPong.String(),
+		sm.Chain.String(),
+		sm.Preemption.String(),
+		sm.GCPause.String(),
+	})
+	s.w.Flush()
+}
+
+// Flush flushes any rows buffered by the underlying csv.Writer.
+func (s *CSVSink) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w.Flush()
+	return s.w.Error()
+}
+
+// ChanSink delivers each Sample on a channel, primarily for use in tests.
+// Record never blocks: if the channel's buffer is full, the sample is
+// dropped.
+type ChanSink struct {
+	C chan Sample
+}
+
+// NewChanSink returns a ChanSink whose channel has the given buffer size.
+func NewChanSink(buffer int) *ChanSink {
+	return &ChanSink{C: make(chan Sample, buffer)}
+}
+
+func (s *ChanSink) Record(sm Sample) {
+	select {
+	case s.C <- sm:
+	default:
+	}
+}
+
+// Flush is a no-op; ChanSink delivers each sample immediately.
+func (s *ChanSink) Flush(ctx context.Context) error { return nil }
@@ -0,0 +1,30 @@
+package sched
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestChanSinkCollectOnce verifies that collectOnce delivers the Sample it
+// records to every registered Sink, using a ChanSink the way a test would.
+func TestChanSinkCollectOnce(t *testing.T) {
+	sink := NewChanSink(1)
+	c := NewCollector(time.Second, sink)
+	c.bufc = make(chan bool, 1)
+	c.unbufc = make(chan bool)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.channelHelper(ctx)
+
+	s := c.collectOnce()
+
+	select {
+	case got := <-sink.C:
+		if got != s {
+			t.Fatalf("sink received %+v, want %+v", got, s)
+		}
+	default:
+		t.Fatal("sink did not receive the recorded sample")
+	}
+}